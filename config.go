@@ -0,0 +1,210 @@
+package gitlabserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"golang.org/x/oauth2"
+)
+
+// AuthMethod selects how Config authenticates against the GitLab instance.
+type AuthMethod int
+
+const (
+	// AuthPersonalToken authenticates with a personal/project access
+	// token. This is the zero value, so it's the default when Config.Auth
+	// is unset.
+	AuthPersonalToken AuthMethod = iota
+	// AuthJobToken authenticates with a CI_JOB_TOKEN.
+	AuthJobToken
+	// AuthOAuth2 authenticates with an OAuth2 token, refreshing it
+	// automatically via Config.OAuth2.
+	AuthOAuth2
+)
+
+// OAuth2Config describes how to obtain and refresh an OAuth2 token, via
+// either the device authorization flow or the authorization-code flow.
+// Exactly one of DeviceCode or AuthCode should be set; whichever is present
+// is used to mint the initial token, which oauth2.TokenSource then
+// refreshes automatically as it expires.
+type OAuth2Config struct {
+	*oauth2.Config
+
+	// DeviceCode, if set, is used to run the device authorization flow.
+	DeviceCode *oauth2.DeviceAuthResponse
+
+	// AuthCode, if set, is exchanged for the initial token via the
+	// authorization-code flow.
+	AuthCode string
+
+	// Token is used directly instead of running a flow when already
+	// available (e.g. restored from a previous run); it's still wrapped
+	// in a TokenSource so it gets refreshed once it expires. Refreshing
+	// needs the embedded *oauth2.Config (ClientID/Endpoint) to make the
+	// refresh request, so if Token.RefreshToken is set, Config must be
+	// too — initialToken rejects the combination of a refreshable token
+	// with no Config instead of letting it panic inside x/oauth2 on the
+	// first refresh.
+	Token *oauth2.Token
+}
+
+// TLSConfig customizes the transport used to reach the GitLab instance.
+type TLSConfig struct {
+	// SkipVerify disables TLS certificate verification. Only meant for
+	// local development against self-signed instances.
+	SkipVerify bool
+
+	// CAFile, if set, is a PEM file of additional CAs to trust, for
+	// self-hosted instances with a private CA.
+	CAFile string
+}
+
+// Config describes how to build a GitlabServer without the caller having
+// to assemble a *gitlab.Client by hand.
+type Config struct {
+	// BaseURL is the instance's API base URL, e.g.
+	// "https://gitlab.example.com/". Empty means gitlab.com.
+	BaseURL string
+
+	Auth AuthMethod
+
+	// Token is the personal/project access token (AuthPersonalToken) or
+	// CI_JOB_TOKEN (AuthJobToken). Unused for AuthOAuth2.
+	Token string
+
+	// OAuth2 configures AuthOAuth2. Required when Auth is AuthOAuth2.
+	OAuth2 *OAuth2Config
+
+	TLS TLSConfig
+
+	// HTTPClient, if set, is used as the base client instead of
+	// http.DefaultClient. When TLS options are set, its Transport is
+	// replaced by a clone of http.DefaultTransport carrying them; OAuth2
+	// wraps it with a refreshing token source.
+	HTTPClient *http.Client
+}
+
+// NewFromConfig builds a GitlabServer for cfg's instance and auth method,
+// so callers don't need to know about gitlab.Client's different
+// constructors or assemble OAuth2/TLS plumbing themselves.
+func NewFromConfig(ctx context.Context, cfg Config) (GitlabServer, error) {
+	var oauthToken *oauth2.Token
+	if cfg.Auth == AuthOAuth2 {
+		if cfg.OAuth2 == nil {
+			return GitlabServer{}, fmt.Errorf("Config.OAuth2 is required for AuthOAuth2")
+		}
+
+		var err error
+		oauthToken, err = cfg.OAuth2.initialToken(ctx)
+		if err != nil {
+			return GitlabServer{}, fmt.Errorf("obtaining initial OAuth2 token: %w", err)
+		}
+	}
+
+	httpClient, err := cfg.httpClient(ctx, oauthToken)
+	if err != nil {
+		return GitlabServer{}, err
+	}
+
+	opts := []gitlab.ClientOptionFunc{gitlab.WithHTTPClient(httpClient)}
+	if cfg.BaseURL != "" {
+		opts = append(opts, gitlab.WithBaseURL(cfg.BaseURL))
+	}
+
+	var client *gitlab.Client
+	switch cfg.Auth {
+	case AuthJobToken:
+		client, err = gitlab.NewJobClient(cfg.Token, opts...)
+	case AuthOAuth2:
+		client, err = gitlab.NewOAuthClient(oauthToken.AccessToken, opts...)
+	default:
+		client, err = gitlab.NewClient(cfg.Token, opts...)
+	}
+	if err != nil {
+		return GitlabServer{}, fmt.Errorf("building gitlab client: %w", err)
+	}
+
+	return NewGitlabServer(client), nil
+}
+
+// httpClient builds the *http.Client NewFromConfig passes to gitlab.Client,
+// applying TLS options and, for AuthOAuth2, a token source that refreshes
+// oauthToken automatically (its Transport overrides the Authorization
+// header on every request, so it stays correct even though the
+// gitlab.Client itself only ever sees the initial token string).
+func (c Config) httpClient(ctx context.Context, oauthToken *oauth2.Token) (*http.Client, error) {
+	base := c.HTTPClient
+	if base == nil {
+		base = &http.Client{}
+	}
+
+	if c.TLS.SkipVerify || c.TLS.CAFile != "" {
+		transport, err := c.TLS.transport()
+		if err != nil {
+			return nil, err
+		}
+
+		clone := *base
+		clone.Transport = transport
+		base = &clone
+	}
+
+	if c.Auth != AuthOAuth2 {
+		return base, nil
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+	return oauth2.NewClient(ctx, c.OAuth2.TokenSource(ctx, oauthToken)), nil
+}
+
+// transport builds an *http.Transport honoring SkipVerify/CAFile.
+func (t TLSConfig) transport() (*http.Transport, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: t.SkipVerify}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file %s: %w", t.CAFile, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// initialToken returns the token to start from, running whichever flow was
+// configured if one isn't already available.
+func (o *OAuth2Config) initialToken(ctx context.Context) (*oauth2.Token, error) {
+	if o == nil {
+		return nil, fmt.Errorf("OAuth2Config is nil")
+	}
+
+	switch {
+	case o.Token != nil:
+		if o.Token.RefreshToken != "" && o.Config == nil {
+			return nil, fmt.Errorf("OAuth2Config.Token has a RefreshToken set but Config is nil; refreshing it would panic inside x/oauth2")
+		}
+		return o.Token, nil
+	case o.DeviceCode != nil:
+		return o.Config.DeviceAccessToken(ctx, o.DeviceCode)
+	case o.AuthCode != "":
+		return o.Config.Exchange(ctx, o.AuthCode)
+	default:
+		return nil, fmt.Errorf("OAuth2Config needs one of Token, DeviceCode, or AuthCode set")
+	}
+}
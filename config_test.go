@@ -0,0 +1,135 @@
+package gitlabserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestInitialTokenRejectsRefreshableTokenWithoutConfig(t *testing.T) {
+	cfg := &OAuth2Config{Token: &oauth2.Token{AccessToken: "x", RefreshToken: "y"}}
+
+	if _, err := cfg.initialToken(context.Background()); err == nil {
+		t.Fatal("initialToken: want an error, not a token that would panic x/oauth2 on refresh")
+	}
+}
+
+func TestInitialTokenAllowsNonRefreshableTokenWithoutConfig(t *testing.T) {
+	cfg := &OAuth2Config{Token: &oauth2.Token{AccessToken: "x"}}
+
+	got, err := cfg.initialToken(context.Background())
+	if err != nil {
+		t.Fatalf("initialToken: %v", err)
+	}
+	if got.AccessToken != "x" {
+		t.Fatalf("got %+v, want AccessToken x", got)
+	}
+}
+
+func TestInitialTokenRequiresOneOption(t *testing.T) {
+	cfg := &OAuth2Config{}
+
+	if _, err := cfg.initialToken(context.Background()); err == nil {
+		t.Fatal("initialToken: want an error when none of Token/DeviceCode/AuthCode is set")
+	}
+}
+
+func TestInitialTokenNilReceiver(t *testing.T) {
+	var cfg *OAuth2Config
+
+	if _, err := cfg.initialToken(context.Background()); err == nil {
+		t.Fatal("initialToken: want an error on a nil OAuth2Config")
+	}
+}
+
+func TestInitialTokenExchangesAuthCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "exchanged-token",
+			"token_type":   "bearer",
+		})
+	}))
+	defer srv.Close()
+
+	cfg := &OAuth2Config{
+		Config: &oauth2.Config{
+			ClientID: "client",
+			Endpoint: oauth2.Endpoint{TokenURL: srv.URL},
+		},
+		AuthCode: "code123",
+	}
+
+	got, err := cfg.initialToken(context.Background())
+	if err != nil {
+		t.Fatalf("initialToken: %v", err)
+	}
+	if got.AccessToken != "exchanged-token" {
+		t.Fatalf("got %+v, want AccessToken exchanged-token", got)
+	}
+}
+
+func TestNewFromConfigOAuth2BuildsClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "exchanged-token",
+			"token_type":   "bearer",
+		})
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		Auth: AuthOAuth2,
+		OAuth2: &OAuth2Config{
+			Config: &oauth2.Config{
+				ClientID: "client",
+				Endpoint: oauth2.Endpoint{TokenURL: srv.URL},
+			},
+			AuthCode: "code123",
+		},
+	}
+
+	if _, err := NewFromConfig(context.Background(), cfg); err != nil {
+		t.Fatalf("NewFromConfig: %v", err)
+	}
+}
+
+func TestNewFromConfigOAuth2RequiresOAuth2Config(t *testing.T) {
+	if _, err := NewFromConfig(context.Background(), Config{Auth: AuthOAuth2}); err == nil {
+		t.Fatal("NewFromConfig: want an error when Auth is AuthOAuth2 and OAuth2 is nil")
+	}
+}
+
+func TestTLSConfigTransportSkipVerify(t *testing.T) {
+	transport, err := TLSConfig{SkipVerify: true}.transport()
+	if err != nil {
+		t.Fatalf("transport: %v", err)
+	}
+	if !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Fatal("transport: want InsecureSkipVerify true")
+	}
+}
+
+func TestTLSConfigTransportMissingCAFile(t *testing.T) {
+	if _, err := (TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}).transport(); err == nil {
+		t.Fatal("transport: want an error for a CA file that doesn't exist")
+	}
+}
+
+func TestTLSConfigTransportInvalidCAFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.pem")
+	if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("writing fixture: %v", err)
+	}
+
+	if _, err := (TLSConfig{CAFile: path}).transport(); err == nil {
+		t.Fatal("transport: want an error when the CA file has no valid certificates")
+	}
+}
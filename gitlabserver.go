@@ -1,37 +1,71 @@
 package gitlabserver
 
 import (
+	"context"
 	"fmt"
-	"math"
 	"net/http"
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"golang.org/x/sync/errgroup"
 )
 
-// TODO: implement request timeout
-
 const (
 	ITEMS_PER_PAGE = 100
+
+	// DefaultMaxConcurrency is the page fan-out used by Projects when
+	// GitlabServer.MaxConcurrency is left at the zero value.
+	DefaultMaxConcurrency = 8
 )
 
 type GitlabServer struct {
 	client *gitlab.Client
+
+	// MaxConcurrency bounds how many pages bulk scans such as Projects
+	// fetch at once. Left at zero, DefaultMaxConcurrency is used.
+	MaxConcurrency int
+
+	// GroupCacheTTL controls how long WalkTree/FetchGroupContent results
+	// are cached. Left at zero, DefaultGroupCacheTTL is used.
+	GroupCacheTTL time.Duration
+
+	// groupCache is a pointer so every GitlabServer copied from the same
+	// NewGitlabServer call shares one cache.
+	groupCache *groupCache
 }
 
 func NewGitlabServer(c *gitlab.Client) GitlabServer {
 	return GitlabServer{
-		client: c,
+		client:         c,
+		MaxConcurrency: DefaultMaxConcurrency,
+		groupCache:     newGroupCache(),
 	}
 }
 
-// ProjectCount connects to the git server instance, authenticates
-// with the token and obtains the total number of projects
-func (g GitlabServer) ProjectCount() (int, error) {
-	req, err := g.client.NewRequest("GET", "projects", nil, nil)
+// Client returns the underlying *gitlab.Client, for callers (such as the
+// mirror package) that need to reach a GitLab API GitlabServer doesn't wrap
+// itself.
+func (g GitlabServer) Client() *gitlab.Client {
+	return g.client
+}
+
+// maxConcurrency returns MaxConcurrency, or DefaultMaxConcurrency if unset.
+func (g GitlabServer) maxConcurrency() int {
+	if g.MaxConcurrency <= 0 {
+		return DefaultMaxConcurrency
+	}
+	return g.MaxConcurrency
+}
+
+// totalCount issues a plain GET against endpoint and reads the X-Total
+// header GitLab attaches to offset-paginated collections. GitLab stops
+// sending X-Total once a collection grows past roughly 10,000 items, so
+// this only works for counting; Paginate does not depend on it.
+func (g GitlabServer) totalCount(endpoint string) (int, error) {
+	req, err := g.client.NewRequest("GET", endpoint, nil, nil)
 	if err != nil {
 		return 0, err
 	}
@@ -43,7 +77,12 @@ func (g GitlabServer) ProjectCount() (int, error) {
 
 	defer res.Body.Close()
 
-	count, err := strconv.Atoi(res.Header["X-Total"][0])
+	total := res.Header.Get("X-Total")
+	if total == "" {
+		return 0, fmt.Errorf("%s: X-Total header not present (collection may be too large for offset pagination)", endpoint)
+	}
+
+	count, err := strconv.Atoi(total)
 	if err != nil {
 		return 0, err
 	}
@@ -51,135 +90,224 @@ func (g GitlabServer) ProjectCount() (int, error) {
 	return count, nil
 }
 
+// ProjectCount connects to the git server instance, authenticates
+// with the token and obtains the total number of projects
+func (g GitlabServer) ProjectCount() (int, error) {
+	return g.totalCount("projects")
+}
+
 // GroupCount connects to an gitlab instance, authenticates
 // with the token and obtains the total number of groups
 func (g GitlabServer) GroupCount() (int, error) {
-	req, err := g.client.NewRequest("GET", "groups", nil, nil)
-	if err != nil {
-		return 0, err
-	}
+	return g.totalCount("groups")
+}
 
-	res, err := g.client.Do(req, nil)
-	if err != nil {
-		return 0, err
-	}
+// UserCount connects to the gitlab instance, authenticates
+// with the token and obtains the total number of users
+func (g GitlabServer) UserCount() (int, error) {
+	return g.totalCount("users")
+}
 
-	defer res.Body.Close()
+// PageFetcher retrieves a single page of results of type T for the given
+// pagination options. reqOpts is forwarded as-is to the underlying
+// *gitlab.Client call so Paginate can inject keyset continuation
+// parameters between pages.
+type PageFetcher[T any] func(opts gitlab.ListOptions, reqOpts ...gitlab.RequestOptionFunc) ([]T, *gitlab.Response, error)
 
-	count, err := strconv.Atoi(res.Header["X-Total"][0])
-	if err != nil {
-		return 0, err
-	}
+// paginateConfig holds the options Paginate's variadic PaginateOptions
+// apply to.
+type paginateConfig struct {
+	keyset bool
+}
 
-	return count, nil
+// PaginateOption customizes a single Paginate call.
+type PaginateOption func(*paginateConfig)
+
+// WithKeysetPagination requests keyset pagination (pagination=keyset,
+// order_by=id, sort=asc) on the initial request instead of waiting for
+// GitLab to switch into it on its own. GitLab only ever returns a
+// Link: rel="next" header, and so only lets Paginate outrun the offset
+// pagination ceiling (roughly 50,000 items), when the request asks for
+// keyset mode up front; plain offset requests never receive one no matter
+// how large the collection grows. Only pass this for endpoints GitLab
+// documents as supporting keyset pagination.
+func WithKeysetPagination() PaginateOption {
+	return func(c *paginateConfig) { c.keyset = true }
 }
 
-// UserCount connects to the gitlab instance, authenticates
-// with the token and obtains the total number of users
-func (g GitlabServer) UserCount() (int, error) {
-	req, err := g.client.NewRequest("GET", "users", nil, nil)
-	if err != nil {
-		return 0, err
+// Paginate drives fetch across every page of a collection and returns the
+// concatenated results. Once under way it follows whichever continuation
+// style the response actually uses: Link: rel="next" via
+// gitlab.WithKeysetPaginationParameters, or the next page number otherwise.
+// Pass WithKeysetPagination to also request keyset mode on the very first
+// page, which is required to reach it at all on endpoints that support it.
+// ctx is attached to every request and aborts the scan as soon as it's
+// canceled.
+func Paginate[T any](ctx context.Context, fetch PageFetcher[T], opts ...PaginateOption) ([]T, error) {
+	cfg := paginateConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
 	}
 
-	res, err := g.client.Do(req, nil)
-	if err != nil {
-		return 0, err
+	listOpts := gitlab.ListOptions{PerPage: ITEMS_PER_PAGE, Page: 1}
+	if cfg.keyset {
+		listOpts.Pagination = "keyset"
+		listOpts.OrderBy = "id"
+		listOpts.Sort = "asc"
 	}
 
-	defer res.Body.Close()
-
-	count, err := strconv.Atoi(res.Header["X-Total"][0])
+	first, resp, err := fetch(listOpts, gitlab.WithContext(ctx))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return count, nil
-}
-
-// Projects returns a slice with all the projects in gitlab
-func (g GitlabServer) Projects() ([]*gitlab.Project, error) {
-	projectCount, err := g.ProjectCount()
+	rest, err := paginateRest(ctx, listOpts, resp, fetch)
 	if err != nil {
 		return nil, err
 	}
 
-	// slice that holds all the projects (declared with initial cap to avoid reallocs)
-	projects := make([]*gitlab.Project, 0, projectCount)
-
-	pagesToCheck := int(math.Ceil(float64(projectCount) / ITEMS_PER_PAGE))
-
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-	wg.Add(pagesToCheck)
-
-	// spin one goroutine for each page, which will get PROJECTS_PER_PAGE projects
-	// & add those projects to a slice (protected by a mutex)
-	for page := 1; page < pagesToCheck+1; page++ { // pages start in 1
-		fmt.Printf("[DEBUG] Scanning projects page %d of %d\n", page, pagesToCheck)
+	return append(first, rest...), nil
+}
 
-		go func(wg *sync.WaitGroup, page int) {
-			defer wg.Done()
+// paginateRest drives fetch across every page after one already retrieved
+// by the caller (opts/resp describe that first request/response), using
+// the same Link-then-page-number continuation logic as Paginate. It's
+// split out so Projects can fetch its first page itself to decide how to
+// fan the rest out, without duplicating the continuation logic.
+func paginateRest[T any](ctx context.Context, opts gitlab.ListOptions, resp *gitlab.Response, fetch PageFetcher[T]) ([]T, error) {
+	var all []T
 
-			opt := &gitlab.ListProjectsOptions{
-				ListOptions: gitlab.ListOptions{
-					PerPage: ITEMS_PER_PAGE,
-					Page:    page,
-				},
-				Archived: &[]bool{false}[0], // avoid archived repos
+	for {
+		switch {
+		case resp.NextLink != "":
+			page, r, err := fetch(opts, gitlab.WithContext(ctx), gitlab.WithKeysetPaginationParameters(resp.NextLink))
+			if err != nil {
+				return nil, err
 			}
-
-			p, resp, err := g.client.Projects.ListProjects(opt)
+			all = append(all, page...)
+			resp = r
+		case resp.NextPage != 0:
+			opts.Page = resp.NextPage
+			page, r, err := fetch(opts, gitlab.WithContext(ctx))
 			if err != nil {
-				fmt.Printf("error %q listing projects page %d: %s", err, page, resp.Status)
+				return nil, err
 			}
-
-			mu.Lock()
-			projects = append(projects, p...)
-			mu.Unlock()
-		}(&wg, page)
-
+			all = append(all, page...)
+			resp = r
+		default:
+			return all, nil
+		}
 	}
-
-	wg.Wait()
-
-	return projects, nil
 }
 
-// Groups returns a slice with all the groups in gitlab
-func (g GitlabServer) Groups() ([]*gitlab.Group, error) {
-	groupCount, err := g.GroupCount()
-	if err != nil {
-		return nil, err
+// Projects returns a slice with all the projects in gitlab, archived ones
+// included — callers that need to exclude archived projects (such as
+// mirror.MirrorOptions.IncludeArchived) filter the result themselves,
+// since Projects has no way to take that as a parameter. It requests
+// keyset pagination from the first page on, so it works on
+// instances with more projects than ProjectCount's X-Total header can
+// report — it never calls ProjectCount to size anything up front. While
+// the response is still in offset mode (small instances, or ones GitLab
+// hasn't switched over yet) the remaining pages are addressable by number,
+// so fetchRemainingPages fans them out g.maxConcurrency() at a time without
+// needing to know the total page count either; once a page comes back
+// short or empty, that's the signal to stop. Once the response switches to
+// keyset mode, pages are only reachable in order via the cursor in
+// Link: rel="next", so the rest of the scan runs sequentially via
+// Paginate's usual continuation logic.
+func (g GitlabServer) Projects(ctx context.Context) ([]*gitlab.Project, error) {
+	fetch := func(opts gitlab.ListOptions, reqOpts ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error) {
+		return g.client.Projects.ListProjects(&gitlab.ListProjectsOptions{
+			ListOptions: opts,
+		}, reqOpts...)
 	}
 
-	// slice that holds all the groups (declared with initial cap to avoid reallocs)
-	groups := make([]*gitlab.Group, 0, groupCount)
-
-	// gather all the gitlab.Group objects into groups var
-	listGroupsOptions := &gitlab.ListGroupsOptions{
-		ListOptions:  gitlab.ListOptions{PerPage: ITEMS_PER_PAGE, Page: 1},
-		TopLevelOnly: &[]bool{true}[0], // hasta que tengamos la v13 en adelante no funciona.. habrÃ¡ que hardcodear hasta entonces
+	opts := gitlab.ListOptions{PerPage: ITEMS_PER_PAGE, Page: 1, Pagination: "keyset", OrderBy: "id", Sort: "asc"}
+	first, resp, err := fetch(opts, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("listing projects page 1: %w", err)
 	}
 
-	for {
-		g, resp, err := g.client.Groups.ListGroups(listGroupsOptions)
+	switch {
+	case resp.NextLink != "":
+		rest, err := paginateRest(ctx, opts, resp, fetch)
 		if err != nil {
 			return nil, err
 		}
+		return append(first, rest...), nil
+	case resp.NextPage != 0:
+		rest, err := g.fetchRemainingPages(ctx, resp.NextPage, fetch)
+		if err != nil {
+			return nil, err
+		}
+		return append(first, rest...), nil
+	default:
+		return first, nil
+	}
+}
+
+// fetchRemainingPages fetches the offset-paginated pages starting at
+// startPage, g.maxConcurrency() at a time, stopping as soon as a batch
+// contains a page with fewer than ITEMS_PER_PAGE results — the usual sign
+// there's nothing left — without ever needing the total page count.
+func (g GitlabServer) fetchRemainingPages(ctx context.Context, startPage int, fetch PageFetcher[*gitlab.Project]) ([]*gitlab.Project, error) {
+	var all []*gitlab.Project
+
+	for page := startPage; ; page += g.maxConcurrency() {
+		batch := make([][]*gitlab.Project, g.maxConcurrency())
+
+		eg, egCtx := errgroup.WithContext(ctx)
+		for i := 0; i < g.maxConcurrency(); i++ {
+			i, p := i, page+i
+			eg.Go(func() error {
+				opts := gitlab.ListOptions{PerPage: ITEMS_PER_PAGE, Page: p}
+				result, _, err := fetch(opts, gitlab.WithContext(egCtx))
+				if err != nil {
+					return fmt.Errorf("listing projects page %d: %w", p, err)
+				}
+				batch[i] = result
+				return nil
+			})
+		}
 
-		groups = append(groups, g...)
-		if resp.NextPage == 0 {
+		if err := eg.Wait(); err != nil {
+			return nil, err
+		}
+
+		done := false
+		for _, result := range batch {
+			all = append(all, result...)
+			if len(result) < ITEMS_PER_PAGE {
+				done = true
+				break
+			}
+		}
+		if done {
 			break
 		}
-		listGroupsOptions.Page = resp.NextPage
 	}
 
-	return groups, nil
+	return all, nil
+}
+
+// Groups returns a slice with all the top-level groups in gitlab
+func (g GitlabServer) Groups(ctx context.Context) ([]*gitlab.Group, error) {
+	topLevelOnly := true
+
+	return Paginate(ctx, func(opts gitlab.ListOptions, reqOpts ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error) {
+		return g.client.Groups.ListGroups(&gitlab.ListGroupsOptions{
+			ListOptions:  opts,
+			TopLevelOnly: &topLevelOnly, // hasta que tengamos la v13 en adelante no funciona.. habrÃ¡ que hardcodear hasta entonces
+		}, reqOpts...)
+	}, WithKeysetPagination())
 }
 
 // TopLevelGroups returns an slice with all the top level
-// groups of "groups", without repetitions
+// groups of "groups", without repetitions.
+//
+// This takes the first segment of each group's FullPath. FetchGroup and
+// WalkTree build the hierarchy from GitLab's actual parent_id/subgroup
+// relationships instead and should be preferred for new code.
 func (g GitlabServer) TopLevelGroups(groups []*gitlab.Group) []string {
 	var topLevelGroups []string
 
@@ -194,7 +322,10 @@ func (g GitlabServer) TopLevelGroups(groups []*gitlab.Group) []string {
 	return topLevelGroups
 }
 
-// ParentGroup returns the parent group of a gitlab project
+// ParentGroup returns the parent group of a gitlab project.
+//
+// This relies on splitting WebURL on the instance's host, which breaks
+// behind a path prefix. Prefer WalkTree for new code.
 func (g GitlabServer) ParentGroup(p *gitlab.Project) string {
 	fullPath := strings.Split(p.WebURL, g.client.BaseURL().Host)
 	parentgroup := strings.Split(fullPath[1], "/")
@@ -278,19 +409,3 @@ func (g GitlabServer) AddMember(p *gitlab.Project, userID int, accessLevel *gitl
 
 	return resp, nil
 }
-
-// AddWebhook adds a webhook to the project pointing to the URL of "webhook"
-func (g GitlabServer) AddWebhook(gitlabAPI *gitlab.Client, webhook string, p *gitlab.Project) (*gitlab.Response, error) {
-	optsHook := gitlab.AddProjectHookOptions{
-		EnableSSLVerification: &[]bool{true}[0],
-		PushEvents:            &[]bool{true}[0],
-		URL:                   &[]string{webhook}[0],
-	}
-
-	_, resp, err := gitlabAPI.Projects.AddProjectHook(p.ID, &optsHook)
-	if err != nil {
-		return resp, err
-	}
-
-	return resp, nil
-}
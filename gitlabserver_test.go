@@ -0,0 +1,124 @@
+package gitlabserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// fakePage is one page a fake PageFetcher hands back, keyed by the page
+// number it expects to be requested on.
+type fakePage struct {
+	items []int
+	resp  *gitlab.Response
+	err   error
+}
+
+func newFetcher(pages map[int]fakePage) PageFetcher[int] {
+	return func(opts gitlab.ListOptions, _ ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+		page, ok := pages[opts.Page]
+		if !ok {
+			return nil, nil, errors.New("unexpected page requested")
+		}
+		return page.items, page.resp, page.err
+	}
+}
+
+func TestPaginateFollowsKeysetLink(t *testing.T) {
+	pages := map[int]fakePage{
+		1: {items: []int{1, 2}, resp: &gitlab.Response{NextLink: "https://example.com/api/v4/projects?cursor=a"}},
+	}
+	// paginateRest re-requests with opts.Page unchanged once NextLink is
+	// set, so the fake fetcher must answer for the same page number twice.
+	fetch := func(opts gitlab.ListOptions, reqOpts ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+		if len(reqOpts) > 1 {
+			return []int{3, 4}, &gitlab.Response{}, nil
+		}
+		return pages[opts.Page].items, pages[opts.Page].resp, nil
+	}
+
+	got, err := Paginate(context.Background(), fetch, WithKeysetPagination())
+	if err != nil {
+		t.Fatalf("Paginate: %v", err)
+	}
+
+	want := []int{1, 2, 3, 4}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPaginateFollowsOffsetNextPage(t *testing.T) {
+	fetch := newFetcher(map[int]fakePage{
+		1: {items: []int{1, 2}, resp: &gitlab.Response{NextPage: 2}},
+		2: {items: []int{3}, resp: &gitlab.Response{}},
+	})
+
+	got, err := Paginate(context.Background(), fetch)
+	if err != nil {
+		t.Fatalf("Paginate: %v", err)
+	}
+
+	want := []int{1, 2, 3}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPaginateStopsWhenNeitherLinkNorNextPageSet(t *testing.T) {
+	calls := 0
+	fetch := func(opts gitlab.ListOptions, _ ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+		calls++
+		return []int{1}, &gitlab.Response{}, nil
+	}
+
+	got, err := Paginate(context.Background(), fetch)
+	if err != nil {
+		t.Fatalf("Paginate: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("fetch called %d times, want 1", calls)
+	}
+	if len(got) != 1 || got[0] != 1 {
+		t.Fatalf("got %v, want [1]", got)
+	}
+}
+
+func TestWithKeysetPaginationSetsInitialRequestParams(t *testing.T) {
+	var gotOpts gitlab.ListOptions
+	fetch := func(opts gitlab.ListOptions, _ ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+		gotOpts = opts
+		return nil, &gitlab.Response{}, nil
+	}
+
+	if _, err := Paginate(context.Background(), fetch, WithKeysetPagination()); err != nil {
+		t.Fatalf("Paginate: %v", err)
+	}
+
+	if gotOpts.Pagination != "keyset" || gotOpts.OrderBy != "id" || gotOpts.Sort != "asc" {
+		t.Fatalf("got %+v, want keyset/id/asc on the initial request", gotOpts)
+	}
+}
+
+func TestPaginatePropagatesFetchError(t *testing.T) {
+	wantErr := errors.New("boom")
+	fetch := func(opts gitlab.ListOptions, _ ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+		return nil, nil, wantErr
+	}
+
+	if _, err := Paginate(context.Background(), fetch); !errors.Is(err, wantErr) {
+		t.Fatalf("got %v, want %v", err, wantErr)
+	}
+}
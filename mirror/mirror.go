@@ -0,0 +1,343 @@
+// Package mirror clones or updates every project on a GitLab instance into
+// a local directory tree that mirrors its group hierarchy, turning
+// gitlabserver's read-only inventory API into a disaster-recovery backup
+// tool.
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/OptareSolutions/gitlabserver"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultConcurrency is the number of projects mirrored at once when
+// MirrorOptions.Concurrency is left at the zero value.
+const DefaultConcurrency = 4
+
+// MirrorOptions configures a Mirror run.
+type MirrorOptions struct {
+	// Dest is the local directory the group hierarchy is mirrored into.
+	Dest string
+
+	// Concurrency bounds how many projects are cloned/updated at once.
+	// Zero means DefaultConcurrency.
+	Concurrency int
+
+	IncludeArchived bool
+	IncludeWikis    bool
+	IncludeIssues   bool
+
+	// SSHKey, if set, is used for SSH remotes via GIT_SSH_COMMAND.
+	SSHKey string
+
+	// HTTPToken, if set, is injected into HTTPURLToRepo as basic-auth
+	// credentials with the user name "oauth2" so HTTPS remotes work
+	// without a stored credential helper.
+	HTTPToken string
+
+	// BareClones clones with `git clone --mirror` and updates with
+	// `git remote update`. Without it, Mirror keeps a normal working
+	// copy and updates with `git pull --ff-only`.
+	BareClones bool
+}
+
+// Action records what Mirror did to a single project.
+type Action string
+
+const (
+	ActionCloned  Action = "cloned"
+	ActionUpdated Action = "updated"
+	ActionSkipped Action = "skipped"
+	ActionFailed  Action = "failed"
+)
+
+// Status is the outcome of mirroring a single project.
+type Status struct {
+	Project *gitlab.Project
+	Path    string
+	Action  Action
+	Err     error
+}
+
+// Mirror clones or updates every project server.Projects returns into
+// opts.Dest, mirroring the group hierarchy on disk; a project outside any
+// group is placed at its own path directly under opts.Dest.
+// A project whose latest commit (per GitlabServer.GetLatestCommit) already
+// matches the local clone's HEAD is left untouched, so a Mirror run can be
+// interrupted and safely resumed by calling it again.
+func Mirror(ctx context.Context, server gitlabserver.GitlabServer, opts MirrorOptions) ([]Status, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	jobs, err := collectJobs(ctx, server, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(opts.Concurrency)
+
+	statuses := make([]Status, len(jobs))
+	for i, j := range jobs {
+		i, j := i, j
+		eg.Go(func() error {
+			statuses[i] = mirrorProject(egCtx, server, opts, j.path, j.project)
+			return nil // per-project errors are carried in Status, not returned
+		})
+	}
+
+	// eg.Wait only ever returns an error from a canceled context, since
+	// mirrorProject itself never returns one.
+	_ = eg.Wait()
+
+	return statuses, nil
+}
+
+type mirrorJob struct {
+	path    string
+	project *gitlab.Project
+}
+
+// collectJobs builds the list of projects to mirror from server.Projects,
+// so every project is included regardless of whether it lives under a
+// group or in someone's personal namespace, together with the path
+// (relative to opts.Dest) each one belongs at.
+func collectJobs(ctx context.Context, server gitlabserver.GitlabServer, opts MirrorOptions) ([]mirrorJob, error) {
+	projects, err := server.Projects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing projects: %w", err)
+	}
+
+	paths, err := groupProjectPaths(ctx, server)
+	if err != nil {
+		return nil, fmt.Errorf("computing group paths: %w", err)
+	}
+
+	jobs := make([]mirrorJob, 0, len(projects))
+	for _, p := range projects {
+		if p.Archived && !opts.IncludeArchived {
+			continue
+		}
+
+		path, ok := paths[p.ID]
+		if !ok {
+			// Not under any group WalkTree reached: a personal-namespace
+			// project. Fall back to its own path so it's still mirrored.
+			path = p.Path
+		}
+
+		jobs = append(jobs, mirrorJob{path: path, project: p})
+	}
+
+	return jobs, nil
+}
+
+// groupProjectPaths walks every top-level group to map each group-owned
+// project's ID to the path (relative to opts.Dest) it belongs at.
+// collectJobs' project list itself comes from server.Projects, not from
+// this walk, so a project this map has no entry for is simply one that
+// isn't under any group rather than one that got dropped.
+func groupProjectPaths(ctx context.Context, server gitlabserver.GitlabServer) (map[int]string, error) {
+	groups, err := server.Groups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing groups: %w", err)
+	}
+
+	var mu sync.Mutex
+	paths := make(map[int]string)
+
+	for _, group := range groups {
+		root, err := server.FetchGroup(ctx, group.ID)
+		if err != nil {
+			return nil, fmt.Errorf("fetching group %d: %w", group.ID, err)
+		}
+
+		err = server.WalkTree(ctx, root.ID, func(path string, p *gitlab.Project) error {
+			mu.Lock()
+			paths[p.ID] = path
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walking group %d: %w", group.ID, err)
+		}
+	}
+
+	return paths, nil
+}
+
+func mirrorProject(ctx context.Context, server gitlabserver.GitlabServer, opts MirrorOptions, path string, p *gitlab.Project) Status {
+	status := Status{Project: p, Path: path}
+
+	dest := filepath.Join(opts.Dest, path)
+	if opts.BareClones {
+		dest += ".git"
+	}
+
+	if repoExists(dest) {
+		if up, err := updateRepo(ctx, server, opts, dest, p); err != nil {
+			status.Action, status.Err = ActionFailed, err
+		} else if up {
+			status.Action = ActionUpdated
+		} else {
+			status.Action = ActionSkipped
+		}
+	} else {
+		if err := cloneRepo(ctx, opts, dest, cloneURL(p, opts)); err != nil {
+			status.Action, status.Err = ActionFailed, err
+		} else {
+			status.Action = ActionCloned
+		}
+	}
+
+	if status.Err == nil && opts.IncludeWikis && p.WikiEnabled {
+		if err := mirrorWiki(ctx, opts, path, p); err != nil {
+			status.Err = fmt.Errorf("mirroring wiki: %w", err)
+		}
+	}
+
+	if status.Err == nil && opts.IncludeIssues {
+		if err := exportIssues(ctx, server, opts, path, p); err != nil {
+			status.Err = fmt.Errorf("exporting issues: %w", err)
+		}
+	}
+
+	return status
+}
+
+func repoExists(dest string) bool {
+	_, err := os.Stat(dest)
+	return err == nil
+}
+
+// updateRepo brings an existing local clone up to date, returning whether
+// it ran an update: false when the local HEAD already matches the
+// project's latest commit, true once the update command succeeded.
+func updateRepo(ctx context.Context, server gitlabserver.GitlabServer, opts MirrorOptions, dest string, p *gitlab.Project) (bool, error) {
+	latest, err := server.GetLatestCommit(p)
+	if err == nil {
+		if head, err := runGit(ctx, opts, dest, "rev-parse", "HEAD"); err == nil && strings.TrimSpace(head) == latest {
+			return false, nil
+		}
+	}
+
+	if opts.BareClones {
+		if _, err := runGit(ctx, opts, dest, "remote", "update"); err != nil {
+			return false, fmt.Errorf("updating %s: %w", dest, err)
+		}
+		return true, nil
+	}
+
+	if _, err := runGit(ctx, opts, dest, "pull", "--ff-only"); err != nil {
+		return false, fmt.Errorf("updating %s: %w", dest, err)
+	}
+	return true, nil
+}
+
+func cloneRepo(ctx context.Context, opts MirrorOptions, dest, url string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(dest), err)
+	}
+
+	args := []string{"clone"}
+	if opts.BareClones {
+		args = append(args, "--mirror")
+	}
+	args = append(args, url, dest)
+
+	if _, err := gitCommand(ctx, opts, args...); err != nil {
+		return fmt.Errorf("cloning %s: %w", url, err)
+	}
+	return nil
+}
+
+func mirrorWiki(ctx context.Context, opts MirrorOptions, path string, p *gitlab.Project) error {
+	dest := filepath.Join(opts.Dest, path+".wiki")
+	if opts.BareClones {
+		dest += ".git"
+	}
+
+	url := wikiURL(p, opts)
+
+	if repoExists(dest) {
+		if opts.BareClones {
+			_, err := runGit(ctx, opts, dest, "remote", "update")
+			return err
+		}
+		_, err := runGit(ctx, opts, dest, "pull", "--ff-only")
+		return err
+	}
+
+	return cloneRepo(ctx, opts, dest, url)
+}
+
+// exportIssues writes every issue of p to a JSON file alongside its mirror,
+// since issues aren't part of the git history a clone would capture.
+func exportIssues(ctx context.Context, server gitlabserver.GitlabServer, opts MirrorOptions, path string, p *gitlab.Project) error {
+	issues, err := gitlabserver.Paginate(ctx, func(listOpts gitlab.ListOptions, reqOpts ...gitlab.RequestOptionFunc) ([]*gitlab.Issue, *gitlab.Response, error) {
+		return server.Client().Issues.ListProjectIssues(p.ID, &gitlab.ListProjectIssuesOptions{ListOptions: listOpts}, reqOpts...)
+	})
+	if err != nil {
+		return fmt.Errorf("listing issues for project %d: %w", p.ID, err)
+	}
+
+	dest := filepath.Join(opts.Dest, path+".issues.json")
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(dest), err)
+	}
+
+	data, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling issues for project %d: %w", p.ID, err)
+	}
+
+	if err := os.WriteFile(dest, data, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", dest, err)
+	}
+	return nil
+}
+
+func cloneURL(p *gitlab.Project, opts MirrorOptions) string {
+	if opts.HTTPToken != "" {
+		return withToken(p.HTTPURLToRepo, opts.HTTPToken)
+	}
+	return p.SSHURLToRepo
+}
+
+func wikiURL(p *gitlab.Project, opts MirrorOptions) string {
+	if opts.HTTPToken != "" {
+		return withToken(strings.TrimSuffix(p.HTTPURLToRepo, ".git")+".wiki.git", opts.HTTPToken)
+	}
+	return strings.TrimSuffix(p.SSHURLToRepo, ".git") + ".wiki.git"
+}
+
+func withToken(url, token string) string {
+	return strings.Replace(url, "https://", fmt.Sprintf("https://oauth2:%s@", token), 1)
+}
+
+func runGit(ctx context.Context, opts MirrorOptions, dir string, args ...string) (string, error) {
+	return gitCommand(ctx, opts, append([]string{"-C", dir}, args...)...)
+}
+
+func gitCommand(ctx context.Context, opts MirrorOptions, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if opts.SSHKey != "" {
+		cmd.Env = append(os.Environ(), fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes", opts.SSHKey))
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,181 @@
+package gitlabserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultGroupCacheTTL is how long FetchGroupContent results are cached
+// when GitlabServer.GroupCacheTTL is left at the zero value.
+const DefaultGroupCacheTTL = 5 * time.Minute
+
+// GroupNode is a single node of the group/subgroup hierarchy. It carries
+// just enough of gitlab.Group to navigate the tree; callers who need the
+// full group object can fetch it themselves by ID via the client.
+type GroupNode struct {
+	ID       int
+	Name     string
+	Path     string
+	ParentID int
+}
+
+func groupNodeFromGroup(group *gitlab.Group) *GroupNode {
+	return &GroupNode{
+		ID:       group.ID,
+		Name:     group.Name,
+		Path:     group.Path,
+		ParentID: group.ParentID,
+	}
+}
+
+type groupCacheEntry struct {
+	subgroups []*GroupNode
+	projects  []*gitlab.Project
+	fetchedAt time.Time
+}
+
+// groupCache is a TTL cache of FetchGroupContent results keyed by group ID.
+// It's held behind a pointer on GitlabServer so every copy of a given
+// server shares the same cache.
+type groupCache struct {
+	mu      sync.Mutex
+	entries map[int]groupCacheEntry
+}
+
+func newGroupCache() *groupCache {
+	return &groupCache{entries: make(map[int]groupCacheEntry)}
+}
+
+func (c *groupCache) get(gid int, ttl time.Duration) (groupCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[gid]
+	if !ok || time.Since(entry.fetchedAt) > ttl {
+		return groupCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *groupCache) set(gid int, entry groupCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[gid] = entry
+}
+
+// InvalidateCache drops every cached FetchGroupContent result, forcing the
+// next WalkTree or FetchGroupContent call to hit the API again.
+func (g GitlabServer) InvalidateCache() {
+	g.groupCache.mu.Lock()
+	defer g.groupCache.mu.Unlock()
+	g.groupCache.entries = make(map[int]groupCacheEntry)
+}
+
+func (g GitlabServer) groupCacheTTL() time.Duration {
+	if g.GroupCacheTTL <= 0 {
+		return DefaultGroupCacheTTL
+	}
+	return g.GroupCacheTTL
+}
+
+// FetchGroup returns the GroupNode for gid.
+func (g GitlabServer) FetchGroup(ctx context.Context, gid int) (*GroupNode, error) {
+	group, _, err := g.client.Groups.GetGroup(gid, &gitlab.GetGroupOptions{}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("fetching group %d: %w", gid, err)
+	}
+
+	return groupNodeFromGroup(group), nil
+}
+
+// FetchGroupContent returns the direct subgroups and projects of node, using a
+// cached result if one was fetched within GroupCacheTTL.
+func (g GitlabServer) FetchGroupContent(ctx context.Context, node *GroupNode) ([]*GroupNode, []*gitlab.Project, error) {
+	if entry, ok := g.groupCache.get(node.ID, g.groupCacheTTL()); ok {
+		return entry.subgroups, entry.projects, nil
+	}
+
+	subgroups, err := Paginate(ctx, func(opts gitlab.ListOptions, reqOpts ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error) {
+		return g.client.Groups.ListSubGroups(node.ID, &gitlab.ListSubGroupsOptions{ListOptions: opts}, reqOpts...)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing subgroups of group %d: %w", node.ID, err)
+	}
+
+	includeSubGroups := false // only this group's own projects; WalkTree recurses into subgroups itself
+	projects, err := Paginate(ctx, func(opts gitlab.ListOptions, reqOpts ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error) {
+		return g.client.Groups.ListGroupProjects(node.ID, &gitlab.ListGroupProjectsOptions{
+			ListOptions:      opts,
+			IncludeSubGroups: &includeSubGroups,
+		}, reqOpts...)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing projects of group %d: %w", node.ID, err)
+	}
+
+	subNodes := make([]*GroupNode, 0, len(subgroups))
+	for _, sg := range subgroups {
+		subNodes = append(subNodes, groupNodeFromGroup(sg))
+	}
+
+	g.groupCache.set(node.ID, groupCacheEntry{subgroups: subNodes, projects: projects, fetchedAt: time.Now()})
+
+	return subNodes, projects, nil
+}
+
+// WalkTree descends the group hierarchy rooted at root, calling visit once
+// for every project it finds with its path relative to root (in the form
+// "group/subgroup/project"). Sibling subgroups are fetched concurrently,
+// bounded by g.maxConcurrency(), the same way Projects fans out pages. The
+// first error returned by visit or by a fetch cancels the remaining walk
+// and is returned by WalkTree. ctx is attached to every request and cancels
+// the walk as soon as it's canceled.
+func (g GitlabServer) WalkTree(ctx context.Context, root int, visit func(path string, p *gitlab.Project) error) error {
+	rootNode, err := g.FetchGroup(ctx, root)
+	if err != nil {
+		return err
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(g.maxConcurrency())
+
+	var walk func(node *GroupNode, path string) error
+	walk = func(node *GroupNode, path string) error {
+		subgroups, projects, err := g.FetchGroupContent(ctx, node)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range projects {
+			if err := visit(path+"/"+p.Path, p); err != nil {
+				return fmt.Errorf("visiting project %s: %w", path+"/"+p.Path, err)
+			}
+		}
+
+		for _, sg := range subgroups {
+			sg := sg
+			childPath := path + "/" + sg.Path
+			eg.Go(func() error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				default:
+				}
+				return walk(sg, childPath)
+			})
+		}
+
+		return nil
+	}
+
+	if err := walk(rootNode, rootNode.Path); err != nil {
+		return err
+	}
+
+	return eg.Wait()
+}
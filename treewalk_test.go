@@ -0,0 +1,44 @@
+package gitlabserver
+
+import (
+	"testing"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+func TestGroupCacheGetHitsWithinTTL(t *testing.T) {
+	c := newGroupCache()
+	c.set(1, groupCacheEntry{
+		projects:  []*gitlab.Project{{ID: 42}},
+		fetchedAt: time.Now(),
+	})
+
+	entry, ok := c.get(1, time.Minute)
+	if !ok {
+		t.Fatal("get: want a hit within TTL")
+	}
+	if len(entry.projects) != 1 || entry.projects[0].ID != 42 {
+		t.Fatalf("got %+v, want the cached entry", entry)
+	}
+}
+
+func TestGroupCacheGetMissesAfterTTLExpires(t *testing.T) {
+	c := newGroupCache()
+	c.set(1, groupCacheEntry{
+		projects:  []*gitlab.Project{{ID: 42}},
+		fetchedAt: time.Now().Add(-time.Hour),
+	})
+
+	if _, ok := c.get(1, time.Minute); ok {
+		t.Fatal("get: want a miss once the entry is older than the TTL")
+	}
+}
+
+func TestGroupCacheGetMissesUnknownID(t *testing.T) {
+	c := newGroupCache()
+
+	if _, ok := c.get(99, time.Minute); ok {
+		t.Fatal("get: want a miss for an ID that was never set")
+	}
+}
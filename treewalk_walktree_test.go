@@ -0,0 +1,214 @@
+package gitlabserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// fakeGroupNode is one node of the tree a fakeTreeServer serves.
+type fakeGroupNode struct {
+	id        int
+	path      string
+	parentID  int
+	subgroups []int
+	projects  []*gitlab.Project
+}
+
+// fakeTreeServer serves just enough of GitLab's group/subgroup/project
+// endpoints for WalkTree, and counts how many requests are in flight at
+// once so tests can assert the walk never exceeds its configured
+// concurrency limit.
+type fakeTreeServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	inFlight    int32
+	maxInFlight int32
+}
+
+func newFakeTreeServer(t *testing.T, nodes map[int]*fakeGroupNode) *fakeTreeServer {
+	t.Helper()
+	fake := &fakeTreeServer{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/groups/", func(w http.ResponseWriter, r *http.Request) {
+		fake.enter()
+		defer fake.leave()
+
+		path := strings.TrimPrefix(r.URL.Path, "/api/v4/groups/")
+
+		var id int
+		switch {
+		case strings.HasSuffix(path, "/subgroups"):
+			fmt.Sscanf(path, "%d/subgroups", &id)
+			node, ok := nodes[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			groups := make([]*gitlab.Group, 0, len(node.subgroups))
+			for _, sid := range node.subgroups {
+				sn := nodes[sid]
+				groups = append(groups, &gitlab.Group{ID: sn.id, Path: sn.path, ParentID: sn.parentID})
+			}
+			writeJSON(t, w, groups)
+		case strings.HasSuffix(path, "/projects"):
+			fmt.Sscanf(path, "%d/projects", &id)
+			node, ok := nodes[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(t, w, node.projects)
+		default:
+			fmt.Sscanf(path, "%d", &id)
+			node, ok := nodes[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(t, w, &gitlab.Group{ID: node.id, Path: node.path, ParentID: node.parentID})
+		}
+	})
+
+	fake.Server = httptest.NewServer(mux)
+	return fake
+}
+
+func (f *fakeTreeServer) enter() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight++
+	if f.inFlight > f.maxInFlight {
+		f.maxInFlight = f.inFlight
+	}
+}
+
+func (f *fakeTreeServer) leave() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight--
+}
+
+func newTreeTestServer(t *testing.T, srv *httptest.Server, maxConcurrency int) GitlabServer {
+	t.Helper()
+	client, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("gitlab.NewClient: %v", err)
+	}
+	g := NewGitlabServer(client)
+	g.MaxConcurrency = maxConcurrency
+	return g
+}
+
+// diamondTree builds a root with two subgroups, each with its own
+// subgroup holding a project, plus a project directly on the root:
+//
+//	1 (root, project "root-proj")
+//	├── 2
+//	│   └── 4 (project "p4")
+//	└── 3
+//	    └── 5 (project "p5")
+func diamondTree() map[int]*fakeGroupNode {
+	return map[int]*fakeGroupNode{
+		1: {id: 1, path: "root", subgroups: []int{2, 3}, projects: []*gitlab.Project{{ID: 100, Path: "root-proj"}}},
+		2: {id: 2, path: "g2", parentID: 1, subgroups: []int{4}},
+		3: {id: 3, path: "g3", parentID: 1, subgroups: []int{5}},
+		4: {id: 4, path: "g4", parentID: 2, projects: []*gitlab.Project{{ID: 104, Path: "p4"}}},
+		5: {id: 5, path: "g5", parentID: 3, projects: []*gitlab.Project{{ID: 105, Path: "p5"}}},
+	}
+}
+
+func TestWalkTreeVisitsEveryProjectAtEveryDepth(t *testing.T) {
+	fake := newFakeTreeServer(t, diamondTree())
+	defer fake.Close()
+	g := newTreeTestServer(t, fake.Server, 8)
+
+	var mu sync.Mutex
+	var paths []string
+	err := g.WalkTree(context.Background(), 1, func(path string, p *gitlab.Project) error {
+		mu.Lock()
+		paths = append(paths, path)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkTree: %v", err)
+	}
+
+	want := map[string]bool{
+		"root/root-proj": true,
+		"root/g2/g4/p4":  true,
+		"root/g3/g5/p5":  true,
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("got %v, want %d paths matching %v", paths, len(want), want)
+	}
+	for _, p := range paths {
+		if !want[p] {
+			t.Fatalf("unexpected path %q, want one of %v", p, want)
+		}
+	}
+}
+
+func TestWalkTreeAbortsOnVisitError(t *testing.T) {
+	fake := newFakeTreeServer(t, diamondTree())
+	defer fake.Close()
+	g := newTreeTestServer(t, fake.Server, 8)
+
+	boom := fmt.Errorf("boom")
+	err := g.WalkTree(context.Background(), 1, func(path string, p *gitlab.Project) error {
+		if path == "root/g2/g4/p4" {
+			return boom
+		}
+		return nil
+	})
+
+	if err == nil {
+		t.Fatal("WalkTree: want an error when visit fails on one branch")
+	}
+}
+
+func TestWalkTreeBoundsConcurrency(t *testing.T) {
+	// A wider tree than the concurrency limit, so the walk can't help but
+	// queue some fetches if the limit is actually being enforced.
+	nodes := map[int]*fakeGroupNode{
+		1: {id: 1, path: "root", subgroups: []int{2, 3, 4, 5}},
+	}
+	for _, id := range []int{2, 3, 4, 5} {
+		nodes[id] = &fakeGroupNode{id: id, path: fmt.Sprintf("g%d", id), parentID: 1, projects: []*gitlab.Project{{ID: id * 100, Path: "p"}}}
+	}
+
+	fake := newFakeTreeServer(t, nodes)
+	defer fake.Close()
+
+	const limit = 2
+	g := newTreeTestServer(t, fake.Server, limit)
+
+	var visited int32
+	err := g.WalkTree(context.Background(), 1, func(path string, p *gitlab.Project) error {
+		atomic.AddInt32(&visited, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkTree: %v", err)
+	}
+	if visited != 4 {
+		t.Fatalf("got %d projects visited, want 4", visited)
+	}
+
+	fake.mu.Lock()
+	max := fake.maxInFlight
+	fake.mu.Unlock()
+	if max > limit {
+		t.Fatalf("got %d requests in flight at once, want at most %d (MaxConcurrency)", max, limit)
+	}
+}
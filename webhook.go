@@ -0,0 +1,171 @@
+package gitlabserver
+
+import (
+	"context"
+	"fmt"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// WebhookSpec describes a project webhook's full configuration. It mirrors
+// gitlab.AddProjectHookOptions/EditProjectHookOptions so a single spec can
+// be used to both create and idempotently update a hook via EnsureWebhook.
+type WebhookSpec struct {
+	Name        string
+	Description string
+	URL         string
+	Token       string
+
+	PushEvents             bool
+	PushEventsBranchFilter string
+	TagPushEvents          bool
+	MergeRequestsEvents    bool
+	NoteEvents             bool
+	ConfidentialNoteEvents bool
+	IssuesEvents           bool
+	PipelineEvents         bool
+	JobEvents              bool
+	WikiPageEvents         bool
+	DeploymentEvents       bool
+	ReleasesEvents         bool
+
+	EnableSSLVerification bool
+	CustomHeaders         map[string]string
+}
+
+// customHeaders always returns a non-nil slice pointer, even when
+// s.CustomHeaders is empty: the option structs declare CustomHeaders
+// omitempty, so a nil here is never sent and EnsureWebhook could never
+// clear headers set by a previous spec.
+func (s WebhookSpec) customHeaders() *[]*gitlab.HookCustomHeader {
+	headers := make([]*gitlab.HookCustomHeader, 0, len(s.CustomHeaders))
+	for k, v := range s.CustomHeaders {
+		headers = append(headers, &gitlab.HookCustomHeader{Key: k, Value: v})
+	}
+	return &headers
+}
+
+func (s WebhookSpec) addOptions() *gitlab.AddProjectHookOptions {
+	return &gitlab.AddProjectHookOptions{
+		Name:                   &s.Name,
+		Description:            &s.Description,
+		URL:                    &s.URL,
+		Token:                  &s.Token,
+		PushEvents:             &s.PushEvents,
+		PushEventsBranchFilter: &s.PushEventsBranchFilter,
+		TagPushEvents:          &s.TagPushEvents,
+		MergeRequestsEvents:    &s.MergeRequestsEvents,
+		NoteEvents:             &s.NoteEvents,
+		ConfidentialNoteEvents: &s.ConfidentialNoteEvents,
+		IssuesEvents:           &s.IssuesEvents,
+		PipelineEvents:         &s.PipelineEvents,
+		JobEvents:              &s.JobEvents,
+		WikiPageEvents:         &s.WikiPageEvents,
+		DeploymentEvents:       &s.DeploymentEvents,
+		ReleasesEvents:         &s.ReleasesEvents,
+		EnableSSLVerification:  &s.EnableSSLVerification,
+		CustomHeaders:          s.customHeaders(),
+	}
+}
+
+func (s WebhookSpec) editOptions() *gitlab.EditProjectHookOptions {
+	return &gitlab.EditProjectHookOptions{
+		Name:                   &s.Name,
+		Description:            &s.Description,
+		URL:                    &s.URL,
+		Token:                  &s.Token,
+		PushEvents:             &s.PushEvents,
+		PushEventsBranchFilter: &s.PushEventsBranchFilter,
+		TagPushEvents:          &s.TagPushEvents,
+		MergeRequestsEvents:    &s.MergeRequestsEvents,
+		NoteEvents:             &s.NoteEvents,
+		ConfidentialNoteEvents: &s.ConfidentialNoteEvents,
+		IssuesEvents:           &s.IssuesEvents,
+		PipelineEvents:         &s.PipelineEvents,
+		JobEvents:              &s.JobEvents,
+		WikiPageEvents:         &s.WikiPageEvents,
+		DeploymentEvents:       &s.DeploymentEvents,
+		ReleasesEvents:         &s.ReleasesEvents,
+		EnableSSLVerification:  &s.EnableSSLVerification,
+		CustomHeaders:          s.customHeaders(),
+	}
+}
+
+// AddWebhook adds a webhook to the project pointing to the URL of "webhook"
+func (g GitlabServer) AddWebhook(webhook string, p *gitlab.Project) (*gitlab.Response, error) {
+	return g.AddWebhookWithSpec(p, WebhookSpec{
+		URL:                   webhook,
+		PushEvents:            true,
+		EnableSSLVerification: true,
+	})
+}
+
+// AddWebhookWithSpec adds a webhook to project p configured per spec.
+func (g GitlabServer) AddWebhookWithSpec(p *gitlab.Project, spec WebhookSpec) (*gitlab.Response, error) {
+	_, resp, err := g.client.Projects.AddProjectHook(p.ID, spec.addOptions())
+	if err != nil {
+		return resp, err
+	}
+
+	return resp, nil
+}
+
+// WebhookAction records what EnsureWebhook did to a project's hook.
+type WebhookAction int
+
+const (
+	WebhookUnchanged WebhookAction = iota
+	WebhookCreated
+	WebhookUpdated
+)
+
+// WebhookResult is the outcome of applying a WebhookSpec to a single
+// project, as returned by EnsureWebhook.
+type WebhookResult struct {
+	Project *gitlab.Project
+	Action  WebhookAction
+	Err     error
+}
+
+// EnsureWebhook makes spec's webhook present on every project in projects:
+// it lists each project's existing hooks, and creates the hook if none of
+// them match spec.URL or edits the matching one in place otherwise, so
+// calling it again with the same spec is a no-op beyond the edit. Errors
+// are per-project and reported in the returned WebhookResult rather than
+// aborting the whole batch.
+func (g GitlabServer) EnsureWebhook(spec WebhookSpec, projects []*gitlab.Project) []WebhookResult {
+	results := make([]WebhookResult, len(projects))
+
+	for i, p := range projects {
+		action, err := g.ensureProjectWebhook(spec, p)
+		results[i] = WebhookResult{Project: p, Action: action, Err: err}
+	}
+
+	return results
+}
+
+func (g GitlabServer) ensureProjectWebhook(spec WebhookSpec, p *gitlab.Project) (WebhookAction, error) {
+	hooks, err := Paginate(context.Background(), func(opts gitlab.ListOptions, reqOpts ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectHook, *gitlab.Response, error) {
+		return g.client.Projects.ListProjectHooks(p.ID, (*gitlab.ListProjectHooksOptions)(&opts), reqOpts...)
+	})
+	if err != nil {
+		return WebhookUnchanged, fmt.Errorf("listing hooks for project %d: %w", p.ID, err)
+	}
+
+	for _, hook := range hooks {
+		if hook.URL != spec.URL {
+			continue
+		}
+
+		if _, _, err := g.client.Projects.EditProjectHook(p.ID, hook.ID, spec.editOptions()); err != nil {
+			return WebhookUnchanged, fmt.Errorf("updating hook %d on project %d: %w", hook.ID, p.ID, err)
+		}
+		return WebhookUpdated, nil
+	}
+
+	if _, _, err := g.client.Projects.AddProjectHook(p.ID, spec.addOptions()); err != nil {
+		return WebhookUnchanged, fmt.Errorf("creating hook on project %d: %w", p.ID, err)
+	}
+
+	return WebhookCreated, nil
+}
@@ -0,0 +1,164 @@
+package gitlabserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// hookFixture is the in-memory state of a project's hooks for
+// newHookTestServer's handler.
+type hookFixture struct {
+	hooks  map[int][]*gitlab.ProjectHook
+	nextID int
+}
+
+// newHookTestServer fakes just enough of GitLab's project hooks API
+// (list/create/edit) for EnsureWebhook: project IDs that aren't in hooks
+// respond 404 to every method, simulating ensureProjectWebhook's
+// per-project error case.
+func newHookTestServer(t *testing.T, hooks map[int][]*gitlab.ProjectHook) *httptest.Server {
+	t.Helper()
+	fixture := &hookFixture{hooks: hooks, nextID: 1000}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/", func(w http.ResponseWriter, r *http.Request) {
+		var pid int
+		var hookID int
+		if n, _ := fmt.Sscanf(r.URL.Path, "/api/v4/projects/%d/hooks/%d", &pid, &hookID); n == 2 {
+			handleSingleHook(t, w, r, fixture, pid, hookID)
+			return
+		}
+		if n, _ := fmt.Sscanf(r.URL.Path, "/api/v4/projects/%d/hooks", &pid); n == 1 {
+			handleHookCollection(t, w, r, fixture, pid)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func handleHookCollection(t *testing.T, w http.ResponseWriter, r *http.Request, fixture *hookFixture, pid int) {
+	t.Helper()
+
+	existing, ok := fixture.hooks[pid]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(t, w, existing)
+	case http.MethodPost:
+		var opts gitlab.AddProjectHookOptions
+		decodeJSON(t, r, &opts)
+
+		hook := &gitlab.ProjectHook{ID: fixture.nextID, URL: *opts.URL}
+		fixture.nextID++
+		fixture.hooks[pid] = append(fixture.hooks[pid], hook)
+		writeJSON(t, w, hook)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func handleSingleHook(t *testing.T, w http.ResponseWriter, r *http.Request, fixture *hookFixture, pid, hookID int) {
+	t.Helper()
+
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var opts gitlab.EditProjectHookOptions
+	decodeJSON(t, r, &opts)
+
+	for _, hook := range fixture.hooks[pid] {
+		if hook.ID == hookID {
+			hook.URL = *opts.URL
+			writeJSON(t, w, hook)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Fatalf("encoding response: %v", err)
+	}
+}
+
+func decodeJSON(t *testing.T, r *http.Request, v any) {
+	t.Helper()
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		t.Fatalf("decoding request body: %v", err)
+	}
+}
+
+func newTestServer(t *testing.T, srv *httptest.Server) GitlabServer {
+	t.Helper()
+	client, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("gitlab.NewClient: %v", err)
+	}
+	return NewGitlabServer(client)
+}
+
+func TestEnsureWebhookCreatesWhenNoMatchingURL(t *testing.T) {
+	srv := newHookTestServer(t, map[int][]*gitlab.ProjectHook{1: {}})
+	defer srv.Close()
+	g := newTestServer(t, srv)
+
+	results := g.EnsureWebhook(WebhookSpec{URL: "https://example.com/hook"}, []*gitlab.Project{{ID: 1}})
+
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("got %+v, want one result with no error", results)
+	}
+	if results[0].Action != WebhookCreated {
+		t.Fatalf("got action %v, want WebhookCreated", results[0].Action)
+	}
+}
+
+func TestEnsureWebhookUpdatesExistingHookByURL(t *testing.T) {
+	srv := newHookTestServer(t, map[int][]*gitlab.ProjectHook{
+		1: {{ID: 7, URL: "https://example.com/hook"}},
+	})
+	defer srv.Close()
+	g := newTestServer(t, srv)
+
+	results := g.EnsureWebhook(WebhookSpec{URL: "https://example.com/hook", PushEvents: true}, []*gitlab.Project{{ID: 1}})
+
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("got %+v, want one result with no error", results)
+	}
+	if results[0].Action != WebhookUpdated {
+		t.Fatalf("got action %v, want WebhookUpdated", results[0].Action)
+	}
+}
+
+func TestEnsureWebhookReportsPerProjectError(t *testing.T) {
+	srv := newHookTestServer(t, map[int][]*gitlab.ProjectHook{1: {}})
+	defer srv.Close()
+	g := newTestServer(t, srv)
+
+	results := g.EnsureWebhook(WebhookSpec{URL: "https://example.com/hook"}, []*gitlab.Project{{ID: 1}, {ID: 999}})
+
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].Err != nil {
+		t.Fatalf("project 1: got err %v, want nil", results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Fatal("project 999: want an error, the fake server has no such project")
+	}
+}
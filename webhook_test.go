@@ -0,0 +1,61 @@
+package gitlabserver
+
+import "testing"
+
+func TestCustomHeadersEmptyIsNotNil(t *testing.T) {
+	headers := WebhookSpec{}.customHeaders()
+
+	if headers == nil {
+		t.Fatal("customHeaders: want a non-nil pointer so EnsureWebhook can clear previously-set headers")
+	}
+	if len(*headers) != 0 {
+		t.Fatalf("got %d headers, want 0", len(*headers))
+	}
+}
+
+func TestCustomHeadersMapsKeysAndValues(t *testing.T) {
+	headers := WebhookSpec{CustomHeaders: map[string]string{"X-Foo": "bar"}}.customHeaders()
+
+	if headers == nil || len(*headers) != 1 {
+		t.Fatalf("got %v, want one header", headers)
+	}
+	if (*headers)[0].Key != "X-Foo" || (*headers)[0].Value != "bar" {
+		t.Fatalf("got %+v, want X-Foo=bar", (*headers)[0])
+	}
+}
+
+func TestAddOptionsMapsSpecFields(t *testing.T) {
+	spec := WebhookSpec{
+		Name:                  "ci",
+		URL:                   "https://example.com/hook",
+		Token:                 "secret",
+		PushEvents:            true,
+		MergeRequestsEvents:   true,
+		EnableSSLVerification: true,
+	}
+
+	opts := spec.addOptions()
+
+	if *opts.Name != spec.Name || *opts.URL != spec.URL || *opts.Token != spec.Token {
+		t.Fatalf("got %+v, want Name/URL/Token from %+v", opts, spec)
+	}
+	if *opts.PushEvents != true || *opts.MergeRequestsEvents != true {
+		t.Fatalf("got %+v, want PushEvents/MergeRequestsEvents true", opts)
+	}
+	if *opts.TagPushEvents != false {
+		t.Fatalf("got %+v, want TagPushEvents false", opts)
+	}
+}
+
+func TestEditOptionsMapsSpecFields(t *testing.T) {
+	spec := WebhookSpec{URL: "https://example.com/hook", IssuesEvents: true}
+
+	opts := spec.editOptions()
+
+	if *opts.URL != spec.URL {
+		t.Fatalf("got %q, want %q", *opts.URL, spec.URL)
+	}
+	if *opts.IssuesEvents != true {
+		t.Fatalf("got %+v, want IssuesEvents true", opts)
+	}
+}